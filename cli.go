@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ddeedev/zsh_merge_history/store"
+)
+
+// runImport merges one or more .zsh_history files into a durable SQLite
+// store, the same parsing `runMerge` uses but landing rows in a database
+// instead of a flat file.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := fs.String("db", "zsh_history.db", "path to the SQLite history store")
+	strict := fs.Bool("strict", false, "abort on the first malformed entry instead of skipping it")
+	dedup := fs.String("dedup", "command", "dedup granularity: command|command+cwd|command+cwd+retval|none")
+	metaFile := fs.String("meta", "", "optional sidecar file of timestamp/cwd/hostname/retval metadata to merge in")
+	fs.Parse(args)
+
+	files := fs.Args()
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: merge_zsh_histories import [-db path] [-strict] [-dedup mode] [-meta path] <history_files...>")
+		os.Exit(1)
+	}
+	if !validDedupMode(*dedup) {
+		log.Fatalf("invalid -dedup mode %q", *dedup)
+	}
+
+	var meta map[int64]MetaRecord
+	if *metaFile != "" {
+		var err error
+		meta, err = loadMetaFile(*metaFile)
+		if err != nil {
+			log.Fatalf("loading -meta file %s: %v", *metaFile, err)
+		}
+	}
+
+	h, err := store.Open(*dbPath)
+	if err != nil {
+		log.Fatalf("opening store: %v", err)
+	}
+	defer h.Close()
+
+	multilineCommand := fmt.Sprintf("TO_BE_REMOVED_%d", time.Now().Unix())
+	validLineRegex := regexp.MustCompile(`^: \d{10,}:\d+;`)
+	commands := make(CommandMap)
+
+	skipped := 0
+	seq := 0
+	for _, histFile := range files {
+		fmt.Fprintf(os.Stderr, "Parsing '%s'\n", histFile)
+		n, err := processHistoryFile(histFile, multilineCommand, validLineRegex, commands, *strict, *dedup, meta, &seq)
+		if err != nil {
+			log.Fatalf("Error processing %s: %v", histFile, err)
+		}
+		skipped += n
+	}
+	fmt.Fprintf(os.Stderr, "%d entries merged, %d lines skipped\n", len(commands), skipped)
+
+	entries := make([]store.Entry, 0, len(commands))
+	for _, e := range commands {
+		entries = append(entries, store.Entry{
+			Command:  strings.ReplaceAll(e.Command, multilineCommand, "\\\n"),
+			Time:     e.Time,
+			Duration: e.Duration,
+			Cwd:      e.Cwd,
+			Hostname: e.Hostname,
+			RetVal:   e.RetVal,
+		})
+	}
+
+	n, err := h.Ingest(entries)
+	if err != nil {
+		log.Fatalf("ingesting entries: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d entries into '%s'\n", n, *dbPath)
+}
+
+// runSearch queries a previously imported store and prints matches in the
+// same zsh history format `runMerge` emits.
+func runSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	dbPath := fs.String("db", "zsh_history.db", "path to the SQLite history store")
+	cmdGlob := fs.String("command", "", "glob pattern to match against the command text")
+	cwd := fs.String("cwd", "", "restrict to commands run in this working directory")
+	since := fs.String("since", "", `start of the time range, e.g. "2 weeks ago"`)
+	until := fs.String("until", "", `end of the time range, e.g. "yesterday"`)
+	retval := fs.Int("retval", -1, "restrict to commands that exited with this code (-1 for any)")
+	limit := fs.Int("limit", 50, "maximum number of results")
+	interactive := fs.Bool("interactive", false, "launch a reverse-search picker instead of a one-shot query")
+	fs.Parse(args)
+
+	h, err := store.Open(*dbPath)
+	if err != nil {
+		log.Fatalf("opening store: %v", err)
+	}
+	defer h.Close()
+
+	opts := store.SearchOpts{
+		CommandGlob: *cmdGlob,
+		Cwd:         *cwd,
+		Since:       *since,
+		Until:       *until,
+		Limit:       *limit,
+	}
+	if *retval >= 0 {
+		opts.RetVal = retval
+	}
+
+	matches, err := h.Search(opts)
+	if err != nil {
+		log.Fatalf("searching store: %v", err)
+	}
+
+	if *interactive {
+		entries := make([]HistoryEntry, len(matches))
+		for i, e := range matches {
+			entries[i] = HistoryEntry{
+				Command:  e.Command,
+				Time:     e.Time,
+				Duration: e.Duration,
+				Cwd:      e.Cwd,
+				Hostname: e.Hostname,
+				RetVal:   e.RetVal,
+			}
+		}
+		if err := runInteractiveSearch(entries); err != nil {
+			log.Fatalf("interactive search: %v", err)
+		}
+		return
+	}
+
+	for _, e := range matches {
+		fmt.Printf(":%11d:%d;%s\n", e.Time, e.Duration, e.Command)
+	}
+}
+
+// runExport dumps the entire store back out as a flat, chronologically
+// ordered .zsh_history file.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := fs.String("db", "zsh_history.db", "path to the SQLite history store")
+	fs.Parse(args)
+
+	h, err := store.Open(*dbPath)
+	if err != nil {
+		log.Fatalf("opening store: %v", err)
+	}
+	defer h.Close()
+
+	entries, err := h.Search(store.SearchOpts{})
+	if err != nil {
+		log.Fatalf("exporting store: %v", err)
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		fmt.Printf(":%11d:%d;%s\n", e.Time, e.Duration, e.Command)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+// validDedupMode reports whether mode is one of the supported -dedup values.
+func validDedupMode(mode string) bool {
+	switch mode {
+	case "command", "command+cwd", "command+cwd+retval", "none":
+		return true
+	}
+	return false
+}
+
+// applyAnnotation checks whether line is a round-tripped #cwd:/#host:/#retval:
+// comment produced by outputMergedCommands, and if so copies it onto entry
+// and reports true so the caller can advance past it.
+func applyAnnotation(entry *HistoryEntry, line string) bool {
+	switch {
+	case len(line) > len("#cwd:") && line[:len("#cwd:")] == "#cwd:":
+		entry.Cwd = line[len("#cwd:"):]
+	case len(line) > len("#host:") && line[:len("#host:")] == "#host:":
+		entry.Hostname = line[len("#host:"):]
+	case len(line) > len("#retval:") && line[:len("#retval:")] == "#retval:":
+		fmt.Sscanf(line[len("#retval:"):], "%d", &entry.RetVal)
+	default:
+		return false
+	}
+	return true
+}
+
+// dedupKey computes the map key processHistoryFile dedups on, according to
+// mode. Every mode except "none" folds in whether the command succeeded, so
+// mirroring the hs9001 fix, a failing command is never treated as a duplicate
+// of a successful run of the same text. seq must be unique across the whole
+// merge (not just the current file) so that "none" behaves as a true
+// lossless passthrough even when two files hold the same command at the same
+// position.
+func dedupKey(entry HistoryEntry, mode string, seq int) string {
+	if mode == "none" {
+		return fmt.Sprintf("%d\x00%s", seq, entry.Command)
+	}
+
+	class := "ok"
+	if entry.RetVal != 0 {
+		class = "fail"
+	}
+
+	switch mode {
+	case "command+cwd":
+		return entry.Command + "\x00" + entry.Cwd + "\x00" + class
+	case "command+cwd+retval":
+		return fmt.Sprintf("%s\x00%s\x00%d", entry.Command, entry.Cwd, entry.RetVal)
+	default: // "command"
+		return entry.Command + "\x00" + class
+	}
+}
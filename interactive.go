@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// runInteractiveSearch launches a single-line reverse-search prompt over
+// entries, filtering by substring as the user types, and prints the
+// selected command to stdout on Enter so it can be bound to a zsh widget
+// for command insertion.
+func runInteractiveSearch(entries []HistoryEntry) error {
+	entries = append([]HistoryEntry(nil), entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Time > entries[j].Time
+	})
+
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("entering raw mode: %w", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	var query string
+	matches := matchEntries(entries, query)
+	cursor := 0
+
+	redraw := func() {
+		fmt.Fprint(os.Stderr, "\r\x1b[2K")
+		fmt.Fprintf(os.Stderr, "(reverse-i-search)`%s': ", query)
+		if len(matches) > 0 {
+			fmt.Fprint(os.Stderr, matches[cursor%len(matches)].Command)
+		}
+	}
+	redraw()
+
+	buf := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			return err
+		}
+
+		switch buf[0] {
+		case '\r', '\n':
+			term.Restore(fd, oldState)
+			if len(matches) > 0 {
+				fmt.Println(matches[cursor%len(matches)].Command)
+			}
+			return nil
+		case 7: // Ctrl-G aborts without printing anything
+			term.Restore(fd, oldState)
+			fmt.Fprintln(os.Stderr)
+			return nil
+		case 18: // Ctrl-R cycles to the next match
+			if len(matches) > 0 {
+				cursor++
+			}
+		case 127, 8: // backspace
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				matches = matchEntries(entries, query)
+				cursor = 0
+			}
+		default:
+			query += string(buf)
+			matches = matchEntries(entries, query)
+			cursor = 0
+		}
+
+		redraw()
+	}
+}
+
+// matchEntries returns entries whose command contains query, most recent first.
+func matchEntries(entries []HistoryEntry, query string) []HistoryEntry {
+	if query == "" {
+		return entries
+	}
+
+	var matches []HistoryEntry
+	for _, e := range entries {
+		if strings.Contains(e.Command, query) {
+			matches = append(matches, e)
+		}
+	}
+	return matches
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -13,111 +14,255 @@ import (
 	"unicode/utf8"
 )
 
-// HistoryEntry represents a zsh history command with timestamp and duration
+// HistoryEntry represents a zsh history command with timestamp and duration.
+// Cwd, Hostname, and RetVal are optional: zsh's own EXTENDED_HISTORY format
+// doesn't carry them, so they're only populated from round-tripped comment
+// annotations or a sidecar -meta file.
 type HistoryEntry struct {
 	Command  string
 	Time     int64
 	Duration int
+	Cwd      string
+	Hostname string
+	RetVal   int
 }
 
-// CommandMap maps commands to their most recent history entry
+// CommandMap maps a dedup key (see dedupKey) to its most recent history entry
 type CommandMap map[string]HistoryEntry
 
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <history_files...>\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Example: %s zsh_history_*.bak ~/.zsh_history > merged_zsh_history\n", os.Args[0])
+		printUsage()
 		os.Exit(1)
 	}
 
-	multilineCommand := fmt.Sprintf("TO_BE_REMOVED_%d", time.Now().Unix())
-	commands := make(CommandMap)
+	switch os.Args[1] {
+	case "import":
+		runImport(os.Args[2:])
+	case "search":
+		runSearch(os.Args[2:])
+	case "export":
+		runExport(os.Args[2:])
+	default:
+		runMerge(os.Args[1:])
+	}
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-strict] [-interactive] [-dedup mode] [-meta path] [-stream] [-mem-limit n] <history_files...>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s import [-db path] [-strict] [-dedup mode] [-meta path] <history_files...>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s search [-db path] [-command glob] [-cwd dir] [-since when] [-until when] [-retval n] [-limit n] [-interactive]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s export [-db path]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Example: %s zsh_history_*.bak ~/.zsh_history > merged_zsh_history\n", os.Args[0])
+}
+
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	interactive := fs.Bool("interactive", false, "launch a reverse-search picker over the merged history instead of printing it")
+	strict := fs.Bool("strict", false, "abort on the first malformed entry instead of skipping it")
+	dedup := fs.String("dedup", "command", "dedup granularity: command|command+cwd|command+cwd+retval|none")
+	metaFile := fs.String("meta", "", "optional sidecar file of timestamp/cwd/hostname/retval metadata to merge in")
+	stream := fs.Bool("stream", false, "stream huge archives through an on-disk k-way merge instead of loading every file's text into RAM (memory still grows with the number of distinct commands; command-only dedup; ignores -dedup, -meta, -strict and -interactive)")
+	memLimit := fs.Int("mem-limit", 10000, "hint for how many distinct commands to expect, used to presize the -stream merge's dedup index")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		printUsage()
+		os.Exit(1)
+	}
 
 	// Sort the file arguments
-	files := os.Args[1:]
+	files := fs.Args()
 	sort.Strings(files)
 
+	if *stream {
+		if err := runStreamingMerge(files, *memLimit); err != nil {
+			log.Fatalf("streaming merge: %v", err)
+		}
+		return
+	}
+
+	if !validDedupMode(*dedup) {
+		log.Fatalf("invalid -dedup mode %q", *dedup)
+	}
+
+	var meta map[int64]MetaRecord
+	if *metaFile != "" {
+		var err error
+		meta, err = loadMetaFile(*metaFile)
+		if err != nil {
+			log.Fatalf("loading -meta file %s: %v", *metaFile, err)
+		}
+	}
+
+	multilineCommand := fmt.Sprintf("TO_BE_REMOVED_%d", time.Now().Unix())
+	commands := make(CommandMap)
+
 	// Compile regex pattern
 	validLineRegex := regexp.MustCompile(`^: \d{10,}:\d+;`)
 
+	skipped := 0
+	seq := 0
 	for _, histFile := range files {
 		fmt.Fprintf(os.Stderr, "Parsing '%s'\n", histFile)
 
-		if err := processHistoryFile(histFile, multilineCommand, validLineRegex, commands); err != nil {
+		n, err := processHistoryFile(histFile, multilineCommand, validLineRegex, commands, *strict, *dedup, meta, &seq)
+		if err != nil {
 			log.Fatalf("Error processing %s: %v", histFile, err)
 		}
+		skipped += n
+	}
+	fmt.Fprintf(os.Stderr, "%d entries merged, %d lines skipped\n", len(commands), skipped)
+
+	if *interactive {
+		entries := make([]HistoryEntry, 0, len(commands))
+		for _, e := range commands {
+			e.Command = strings.ReplaceAll(e.Command, multilineCommand, "\\\n")
+			entries = append(entries, e)
+		}
+		if err := runInteractiveSearch(entries); err != nil {
+			log.Fatalf("interactive search: %v", err)
+		}
+		return
 	}
 
 	// Output merged commands sorted by timestamp
 	outputMergedCommands(commands, multilineCommand)
 }
 
-func processHistoryFile(filename, multilineCommand string, validLineRegex *regexp.Regexp, commands CommandMap) error {
+// processHistoryFile parses filename into commands. In tolerant mode (the
+// default) a malformed entry is logged to stderr and skipped rather than
+// aborting the whole merge; it returns how many lines were skipped. Pass
+// strict to restore the old fail-fast behavior. dedupMode controls which
+// entries are considered duplicates of each other (see dedupKey), and meta
+// fills in Cwd/Hostname/RetVal for entries looked up by timestamp. seq is a
+// counter shared across every file in the run, so dedupKey's "none" mode can
+// key on a value that's unique across the whole merge rather than just this
+// one file.
+func processHistoryFile(filename, multilineCommand string, validLineRegex *regexp.Regexp, commands CommandMap, strict bool, dedupMode string, meta map[int64]MetaRecord, seq *int) (int, error) {
 	file, err := os.Open(filename)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer file.Close()
 
 	// Read entire file content
 	content, err := readFileContent(file)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Replace multiline command continuations (but not those followed by timestamp lines)
-	content = replaceMultilineCommands(content, multilineCommand)
+	content, unterminated := replaceMultilineCommands(content, multilineCommand)
+	if unterminated {
+		if strict {
+			return 0, fmt.Errorf("unterminated '\\' continuation before EOF")
+		}
+		fmt.Fprintf(os.Stderr, "warning: '%s' has an unterminated '\\' continuation before EOF; truncating the trailing command\n", filename)
+	}
 
 	// Process each line, filtering out invalid ones
 	lines := strings.Split(content, "\n")
 
-	for _, line := range lines {
+	skipped := 0
+	offset := 0
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
 		if line == "" || !validLineRegex.MatchString(line) {
+			offset += len(line) + 1
 			continue
 		}
 
 		entry, err := parseHistoryLine(line)
 		if err != nil {
-			return fmt.Errorf("error parsing line '%s': %v", line, err)
+			if strict {
+				return skipped, fmt.Errorf("error parsing line '%s': %v", line, err)
+			}
+			fmt.Fprintf(os.Stderr, "skipping corrupted entry at byte offset %d: %q (%v)\n", offset, line, err)
+			skipped++
+			offset += len(line) + 1
+			continue
+		}
+		offset += len(line) + 1
+
+		// Consume any round-tripped #cwd:/#host:/#retval: annotation lines
+		// that immediately follow this entry.
+		for i+1 < len(lines) && applyAnnotation(&entry, lines[i+1]) {
+			i++
+			offset += len(lines[i]) + 1
+		}
+
+		if m, ok := meta[entry.Time]; ok {
+			if entry.Cwd == "" {
+				entry.Cwd = m.Cwd
+			}
+			if entry.Hostname == "" {
+				entry.Hostname = m.Hostname
+			}
+			if entry.RetVal == 0 {
+				entry.RetVal = m.RetVal
+			}
 		}
 
-		// Keep the most recent entry for each command
-		if existing, exists := commands[entry.Command]; !exists || entry.Time > existing.Time {
-			commands[entry.Command] = entry
+		*seq++
+		key := dedupKey(entry, dedupMode, *seq)
+		if existing, exists := commands[key]; !exists || entry.Time > existing.Time {
+			commands[key] = entry
 		}
 	}
 
-	return nil
+	return skipped, nil
 }
 
-func replaceMultilineCommands(content, multilineCommand string) string {
+// replaceMultilineCommands joins '\'-terminated physical lines into one
+// logical line (marked with multilineCommand) up to the next timestamp line.
+// It reports unterminated=true if a continuation never finds a resyncing
+// timestamp line before EOF, so the caller can warn instead of silently
+// swallowing the rest of the file into one bogus command.
+func replaceMultilineCommands(content, multilineCommand string) (string, bool) {
 	timestampRegex := regexp.MustCompile(`:\s*\d{10,}`)
 
-	// Use a simple approach: replace all \n that are NOT followed by a timestamp line
 	lines := strings.Split(content, "\n")
 	var result strings.Builder
 
-	for i, line := range lines {
-		if strings.HasSuffix(line, `\`) && i+1 < len(lines) {
-			// Check if the next line starts with a timestamp pattern
-			nextLine := lines[i+1]
-			if !timestampRegex.MatchString(nextLine) {
-				// Replace backslash with our placeholder but keep building the line
-				result.WriteString(strings.TrimSuffix(line, `\`))
-				result.WriteString(multilineCommand)
-			} else {
-				result.WriteString(line)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if !strings.HasSuffix(line, `\`) || i+1 >= len(lines) {
+			result.WriteString(line)
+			if i < len(lines)-1 {
 				result.WriteString("\n")
 			}
-		} else {
+			continue
+		}
+
+		if timestampRegex.MatchString(lines[i+1]) {
 			result.WriteString(line)
-			if i < len(lines)-1 { // Don't add newline after last line
-				result.WriteString("\n")
+			result.WriteString("\n")
+			continue
+		}
+
+		resynced := false
+		for j := i + 1; j < len(lines); j++ {
+			if timestampRegex.MatchString(lines[j]) {
+				resynced = true
+				break
 			}
 		}
+		if !resynced {
+			// Nothing left in the file looks like a timestamp: drop the
+			// trailing backslash and stop instead of merging everything
+			// that remains into a single command.
+			result.WriteString(strings.TrimSuffix(line, `\`))
+			return result.String(), true
+		}
+
+		result.WriteString(strings.TrimSuffix(line, `\`))
+		result.WriteString(multilineCommand)
 	}
 
-	return result.String()
+	return result.String(), false
 }
 
 func readFileContent(file *os.File) (string, error) {
@@ -204,5 +349,17 @@ func outputMergedCommands(commands CommandMap, multilineCommand string) {
 		// Restore multiline commands
 		command := strings.ReplaceAll(entry.Command, multilineCommand, "\\\n")
 		fmt.Printf(":%11d:%d;%s\n", entry.Time, entry.Duration, command)
+
+		// Round-trip the optional fields as comment-annotated lines so a
+		// later merge can recover them without a -meta file.
+		if entry.Cwd != "" {
+			fmt.Printf("#cwd:%s\n", entry.Cwd)
+		}
+		if entry.Hostname != "" {
+			fmt.Printf("#host:%s\n", entry.Hostname)
+		}
+		if entry.RetVal != 0 {
+			fmt.Printf("#retval:%d\n", entry.RetVal)
+		}
 	}
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+)
+
+// tempFileCursor pairs the next undecoded entry from one sorted temp file
+// with the decoder that produced it, so the heap can pull that file's
+// following entry once this one is popped.
+type tempFileCursor struct {
+	entry HistoryEntry
+	dec   *gob.Decoder
+}
+
+type cursorHeap []*tempFileCursor
+
+func (h cursorHeap) Len() int            { return len(h) }
+func (h cursorHeap) Less(i, j int) bool  { return h[i].entry.Time < h[j].entry.Time }
+func (h cursorHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap) Push(x interface{}) { *h = append(*h, x.(*tempFileCursor)) }
+func (h *cursorHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// kWayMergeTempFiles performs a streaming min-heap merge of the sorted temp
+// files produced by sortEntriesToTempFile, keyed by timestamp. It first makes
+// a lightweight pass over the same files to record each command's last
+// (maximum) timestamp via indexLastOccurrences, then emits an entry from the
+// merge only when it's that command's last occurrence. That makes
+// command-only dedup exact: a bounded LRU can't tell a command that's done
+// recurring from one that will reappear later, so evicting early either
+// reorders output or, worse, lets an evicted command's later recurrence be
+// emitted again as a duplicate. memLimit only sizes the index map's initial
+// capacity as a hint; it no longer caps memory, since exact last-occurrence
+// dedup needs to remember every distinct command for the whole run.
+func kWayMergeTempFiles(paths []string, memLimit int, emit func(HistoryEntry)) error {
+	lastSeen, err := indexLastOccurrences(paths, memLimit)
+	if err != nil {
+		return err
+	}
+
+	h := &cursorHeap{}
+	heap.Init(h)
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+
+		dec := gob.NewDecoder(f)
+		var e HistoryEntry
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF {
+				continue // empty temp file
+			}
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		heap.Push(h, &tempFileCursor{entry: e, dec: dec})
+	}
+
+	emitted := make(map[string]bool, memLimit)
+
+	for h.Len() > 0 {
+		top := heap.Pop(h).(*tempFileCursor)
+
+		// Ties in lastSeen (two occurrences of the same command at the same
+		// timestamp) would otherwise both match; emitted makes sure only the
+		// first one the heap visits goes out.
+		if top.entry.Time == lastSeen[top.entry.Command] && !emitted[top.entry.Command] {
+			emitted[top.entry.Command] = true
+			emit(top.entry)
+		}
+
+		var next HistoryEntry
+		if err := top.dec.Decode(&next); err == nil {
+			top.entry = next
+			heap.Push(h, top)
+		} else if err != io.EOF {
+			return fmt.Errorf("reading next entry from temp file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// indexLastOccurrences makes one sequential pass over each sorted temp file,
+// recording the latest timestamp seen for each distinct command. sizeHint
+// presizes the map (it's typically close to the number of distinct commands
+// in the run) but doesn't bound it.
+func indexLastOccurrences(paths []string, sizeHint int) (map[string]int64, error) {
+	lastSeen := make(map[string]int64, sizeHint)
+
+	for _, path := range paths {
+		if err := func() error {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			dec := gob.NewDecoder(f)
+			for {
+				var e HistoryEntry
+				if err := dec.Decode(&e); err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return fmt.Errorf("indexing %s: %w", path, err)
+				}
+				if e.Time > lastSeen[e.Command] {
+					lastSeen[e.Command] = e.Time
+				}
+			}
+		}(); err != nil {
+			return nil, err
+		}
+	}
+
+	return lastSeen, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func tempFileFromEntries(t *testing.T, entries []HistoryEntry) string {
+	t.Helper()
+	c := make(chan HistoryEntry)
+	go func() {
+		defer close(c)
+		for _, e := range entries {
+			c <- e
+		}
+	}()
+
+	path, err := sortEntriesToTempFile(c)
+	if err != nil {
+		t.Fatalf("sortEntriesToTempFile: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(path) })
+	return path
+}
+
+func TestKWayMergeTempFilesOrdering(t *testing.T) {
+	a := tempFileFromEntries(t, []HistoryEntry{
+		{Command: "one", Time: 1},
+		{Command: "three", Time: 3},
+		{Command: "five", Time: 5},
+	})
+	b := tempFileFromEntries(t, []HistoryEntry{
+		{Command: "two", Time: 2},
+		{Command: "four", Time: 4},
+	})
+
+	var got []HistoryEntry
+	if err := kWayMergeTempFiles([]string{a, b}, 10, func(e HistoryEntry) {
+		got = append(got, e)
+	}); err != nil {
+		t.Fatalf("kWayMergeTempFiles: %v", err)
+	}
+
+	var times []int64
+	for _, e := range got {
+		times = append(times, e.Time)
+	}
+	want := []int64{1, 2, 3, 4, 5}
+	if !reflect.DeepEqual(times, want) {
+		t.Errorf("emitted order = %v, want %v", times, want)
+	}
+}
+
+func TestKWayMergeTempFilesDedupesRecurringCommand(t *testing.T) {
+	// Three distinct commands with a mem-limit of 2: the limit only presizes
+	// the dedup index, so "ls" must still come out once, at its last time.
+	path := tempFileFromEntries(t, []HistoryEntry{
+		{Command: "ls", Time: 1},
+		{Command: "cd /tmp", Time: 2},
+		{Command: "git status", Time: 3},
+		{Command: "ls", Time: 4},
+	})
+
+	var got []HistoryEntry
+	if err := kWayMergeTempFiles([]string{path}, 2, func(e HistoryEntry) {
+		got = append(got, e)
+	}); err != nil {
+		t.Fatalf("kWayMergeTempFiles: %v", err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("got %d entries, want 3 (one per distinct command): %+v", len(got), got)
+	}
+
+	seen := map[string]int64{}
+	for _, e := range got {
+		if _, dup := seen[e.Command]; dup {
+			t.Fatalf("command %q emitted more than once", e.Command)
+		}
+		seen[e.Command] = e.Time
+	}
+	if seen["ls"] != 4 {
+		t.Errorf("ls kept at Time = %d, want its last occurrence (4)", seen["ls"])
+	}
+}
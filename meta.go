@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MetaRecord carries the sidecar fields zsh's EXTENDED_HISTORY format doesn't
+// include on its own, looked up by timestamp.
+type MetaRecord struct {
+	Cwd      string
+	Hostname string
+	RetVal   int
+}
+
+// loadMetaFile reads a tab-separated "timestamp\tcwd\thostname\tretval" file,
+// as produced by tools like Atuin or hs9001 exports, keyed by timestamp.
+// Malformed lines are skipped with a warning rather than aborting the merge.
+func loadMetaFile(path string) (map[int64]MetaRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make(map[int64]MetaRecord)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			fmt.Fprintf(os.Stderr, "skipping malformed meta line in '%s': %q\n", path, line)
+			continue
+		}
+
+		ts, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping malformed meta line in '%s': %q (%v)\n", path, line, err)
+			continue
+		}
+
+		retval, err := strconv.Atoi(fields[3])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping malformed meta line in '%s': %q (%v)\n", path, line, err)
+			continue
+		}
+
+		records[ts] = MetaRecord{Cwd: fields[1], Hostname: fields[2], RetVal: retval}
+	}
+
+	return records, scanner.Err()
+}
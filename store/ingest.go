@@ -0,0 +1,28 @@
+package store
+
+// Ingest writes entries into the history table and returns how many rows
+// were inserted.
+func (h *History) Ingest(entries []Entry) (int, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO history (command, timestamp, duration, cwd, hostname, user, retval) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var n int
+	for _, e := range entries {
+		if _, err := stmt.Exec(e.Command, e.Time, e.Duration, e.Cwd, e.Hostname, e.User, e.RetVal); err != nil {
+			tx.Rollback()
+			return n, err
+		}
+		n++
+	}
+
+	return n, tx.Commit()
+}
@@ -0,0 +1,43 @@
+package store
+
+import "fmt"
+
+// migrations holds the schema in order; migrations[0] bootstraps the
+// versions table itself and is always applied before the version is read.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS versions (version INTEGER NOT NULL);`,
+	`CREATE TABLE IF NOT EXISTS history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		command TEXT NOT NULL,
+		timestamp INTEGER NOT NULL,
+		duration INTEGER NOT NULL DEFAULT 0,
+		cwd TEXT NOT NULL DEFAULT '',
+		hostname TEXT NOT NULL DEFAULT '',
+		user TEXT NOT NULL DEFAULT '',
+		retval INTEGER NOT NULL DEFAULT 0
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_history_command ON history(command);`,
+	`CREATE INDEX IF NOT EXISTS idx_history_timestamp ON history(timestamp);`,
+}
+
+func (h *History) migrate() error {
+	if _, err := h.db.Exec(migrations[0]); err != nil {
+		return err
+	}
+
+	var current int
+	if err := h.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM versions`).Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations)-1; i++ {
+		if _, err := h.db.Exec(migrations[i+1]); err != nil {
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+		if _, err := h.db.Exec(`INSERT INTO versions (version) VALUES (?)`, i+1); err != nil {
+			return fmt.Errorf("recording migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchOpts narrows a Search call across command glob, working directory, a
+// time range, and return code. Zero values are treated as "no filter".
+type SearchOpts struct {
+	CommandGlob string
+	Cwd         string
+	Since       string // natural-language or RFC3339, e.g. "2 weeks ago"
+	Until       string
+	RetVal      *int
+	Limit       int
+}
+
+// GetByPrefix returns entries whose command starts with prefix, most recent first.
+func (h *History) GetByPrefix(prefix string) ([]Entry, error) {
+	return h.query(`SELECT command, timestamp, duration, cwd, hostname, user, retval FROM history WHERE instr(command, ?) = 1 ORDER BY timestamp DESC`, prefix)
+}
+
+// GetByPattern returns entries whose command matches the given SQLite GLOB pattern.
+func (h *History) GetByPattern(pattern string) ([]Entry, error) {
+	return h.query(`SELECT command, timestamp, duration, cwd, hostname, user, retval FROM history WHERE command GLOB ? ORDER BY timestamp DESC`, pattern)
+}
+
+// Search runs a filtered query against the store according to opts.
+func (h *History) Search(opts SearchOpts) ([]Entry, error) {
+	query := `SELECT command, timestamp, duration, cwd, hostname, user, retval FROM history WHERE 1=1`
+	var args []interface{}
+
+	if opts.CommandGlob != "" {
+		query += ` AND command GLOB ?`
+		args = append(args, opts.CommandGlob)
+	}
+	if opts.Cwd != "" {
+		query += ` AND cwd = ?`
+		args = append(args, opts.Cwd)
+	}
+	if opts.Since != "" {
+		t, err := parseRelativeTime(opts.Since)
+		if err != nil {
+			return nil, fmt.Errorf("parsing since %q: %w", opts.Since, err)
+		}
+		query += ` AND timestamp >= ?`
+		args = append(args, t.Unix())
+	}
+	if opts.Until != "" {
+		t, err := parseRelativeTime(opts.Until)
+		if err != nil {
+			return nil, fmt.Errorf("parsing until %q: %w", opts.Until, err)
+		}
+		query += ` AND timestamp <= ?`
+		args = append(args, t.Unix())
+	}
+	if opts.RetVal != nil {
+		query += ` AND retval = ?`
+		args = append(args, *opts.RetVal)
+	}
+
+	query += ` ORDER BY timestamp DESC`
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, opts.Limit)
+	}
+
+	return h.query(query, args...)
+}
+
+func (h *History) query(query string, args ...interface{}) ([]Entry, error) {
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.Command, &e.Time, &e.Duration, &e.Cwd, &e.Hostname, &e.User, &e.RetVal); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// parseRelativeTime understands a handful of natural-language offsets
+// ("2 weeks ago", "3 days ago", "yesterday", "now") in addition to RFC3339
+// timestamps, so Search can take the same loose strings a user would type at
+// a shell prompt.
+func parseRelativeTime(s string) (time.Time, error) {
+	raw := strings.TrimSpace(s)
+	s = strings.ToLower(raw)
+
+	switch s {
+	case "now":
+		return time.Now(), nil
+	case "yesterday":
+		return time.Now().AddDate(0, 0, -1), nil
+	}
+
+	if strings.HasSuffix(s, "ago") {
+		fields := strings.Fields(strings.TrimSuffix(s, "ago"))
+		if len(fields) == 2 {
+			if n, err := strconv.Atoi(fields[0]); err == nil {
+				switch strings.TrimSuffix(fields[1], "s") {
+				case "minute":
+					return time.Now().Add(-time.Duration(n) * time.Minute), nil
+				case "hour":
+					return time.Now().Add(-time.Duration(n) * time.Hour), nil
+				case "day":
+					return time.Now().AddDate(0, 0, -n), nil
+				case "week":
+					return time.Now().AddDate(0, 0, -7*n), nil
+				case "month":
+					return time.Now().AddDate(0, -n, 0), nil
+				case "year":
+					return time.Now().AddDate(-n, 0, 0), nil
+				}
+			}
+		}
+	}
+
+	return time.Parse(time.RFC3339, raw)
+}
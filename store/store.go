@@ -0,0 +1,49 @@
+// Package store provides a persistent SQLite-backed history store so merged
+// zsh history can be queried later instead of only ever being written out as
+// a flat file.
+package store
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Entry is a single imported history record, independent of how it was parsed.
+type Entry struct {
+	Command  string
+	Time     int64
+	Duration int
+	Cwd      string
+	Hostname string
+	User     string
+	RetVal   int
+}
+
+// History wraps a SQLite database holding merged history entries.
+type History struct {
+	db *sql.DB
+}
+
+// Open opens (creating if necessary) the history store at path and runs any
+// pending migrations.
+func Open(path string) (*History, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+
+	h := &History{db: db}
+	if err := h.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating store: %w", err)
+	}
+
+	return h, nil
+}
+
+// Close releases the underlying database handle.
+func (h *History) Close() error {
+	return h.db.Close()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// runStreamingMerge merges files through the streaming pipeline: parse
+// each file incrementally, sort its entries to a temp file on disk, then
+// k-way merge the temp files with an exact last-occurrence dedup index. It
+// never holds the raw text of the archives in RAM, but its memory is not
+// bounded: one file's parsed entries are held while they're sorted, and the
+// dedup index keeps one entry per distinct command for the whole run. It
+// only supports command-only dedup rather than the -dedup/-meta options of
+// the default in-memory path.
+func runStreamingMerge(files []string, memLimit int) error {
+	var tempPaths []string
+	defer func() {
+		for _, p := range tempPaths {
+			os.Remove(p)
+		}
+	}()
+
+	skipped := 0
+	for _, histFile := range files {
+		fmt.Fprintf(os.Stderr, "Parsing '%s'\n", histFile)
+
+		entries, skippedc, errc := streamHistoryFile(histFile)
+		path, err := sortEntriesToTempFile(entries)
+		if err != nil {
+			return fmt.Errorf("sorting %s: %w", histFile, err)
+		}
+		if err := <-errc; err != nil {
+			return fmt.Errorf("reading %s: %w", histFile, err)
+		}
+		skipped += <-skippedc
+
+		tempPaths = append(tempPaths, path)
+	}
+
+	merged := 0
+	err := kWayMergeTempFiles(tempPaths, memLimit, func(e HistoryEntry) {
+		merged++
+		fmt.Printf(":%11d:%d;%s\n", e.Time, e.Duration, e.Command)
+	})
+	fmt.Fprintf(os.Stderr, "%d entries merged, %d lines skipped\n", merged, skipped)
+	return err
+}
+
+// streamHistoryFile scans filename incrementally with a bufio.Scanner sized
+// for gigabyte-scale archives, resolving '\'-continuations as it goes, and
+// emits one HistoryEntry at a time on the returned channel instead of
+// buffering the whole file in memory the way processHistoryFile does. A
+// malformed entry is logged to stderr and counted on the returned skipped
+// channel (sent once, when the scan ends, just before errc and entries are
+// closed; the channel is buffered so the send never blocks),
+// mirroring the tolerant default of processHistoryFile instead of dropping
+// it with no visibility.
+func streamHistoryFile(filename string) (<-chan HistoryEntry, <-chan int, <-chan error) {
+	entries := make(chan HistoryEntry)
+	skippedc := make(chan int, 1)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(entries)
+		defer close(errc)
+
+		skipped := 0
+		defer func() { skippedc <- skipped; close(skippedc) }()
+
+		file, err := os.Open(filename)
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+		validLineRegex := regexp.MustCompile(`^: \d{10,}:\d+;`)
+		timestampRegex := regexp.MustCompile(`:\s*\d{10,}`)
+
+		var pending strings.Builder
+		recording := false
+		entryStartLine := 0
+
+		flush := func(line string) {
+			if entry, err := parseHistoryLine(line); err == nil {
+				entries <- entry
+			} else {
+				fmt.Fprintf(os.Stderr, "skipping corrupted entry at line %d in %s: %q (%v)\n", entryStartLine, filename, line, err)
+				skipped++
+			}
+		}
+
+		// One-line lookahead so a trailing '\' can be checked against the
+		// next line the same way replaceMultilineCommands does: a line
+		// immediately followed by a timestamp line is a literal backslash,
+		// not a continuation.
+		hasLine := scanner.Scan()
+		var line string
+		lineNum := 0
+		if hasLine {
+			line = scanner.Text()
+			lineNum = 1
+		}
+
+		for hasLine {
+			hasNext := scanner.Scan()
+			var next string
+			if hasNext {
+				next = scanner.Text()
+			}
+
+			if !recording {
+				if !validLineRegex.MatchString(line) {
+					line = next
+					hasLine = hasNext
+					lineNum++
+					continue
+				}
+				recording = true
+				entryStartLine = lineNum
+				pending.Reset()
+			} else {
+				pending.WriteString("\\\n")
+			}
+
+			endsBackslash := strings.HasSuffix(line, `\`)
+			continuing := endsBackslash && hasNext && !timestampRegex.MatchString(next)
+
+			switch {
+			case continuing:
+				// Definitely a continuation: the marker above already carries
+				// the '\' across the line break, so drop this line's own copy.
+				pending.WriteString(strings.TrimSuffix(line, `\`))
+			case endsBackslash && !hasNext:
+				// Unterminated continuation at EOF: drop the backslash instead
+				// of leaving it embedded in the command text.
+				pending.WriteString(strings.TrimSuffix(line, `\`))
+			default:
+				// Either no trailing backslash, or a literal one immediately
+				// followed by a resyncing timestamp line: keep it as-is.
+				pending.WriteString(line)
+			}
+
+			if !continuing {
+				flush(pending.String())
+				recording = false
+			}
+
+			line = next
+			hasLine = hasNext
+			lineNum++
+		}
+
+		if err := scanner.Err(); err != nil {
+			errc <- err
+		}
+	}()
+
+	return entries, skippedc, errc
+}
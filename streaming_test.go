@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func writeTempHistory(t *testing.T, content string) string {
+	t.Helper()
+	f, err := os.CreateTemp("", "zsh-merge-test-*.hist")
+	if err != nil {
+		t.Fatalf("creating temp file: %v", err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatalf("writing temp file: %v", err)
+	}
+	f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	return f.Name()
+}
+
+func drainStream(t *testing.T, filename string) ([]HistoryEntry, int) {
+	t.Helper()
+	entries, skippedc, errc := streamHistoryFile(filename)
+
+	var got []HistoryEntry
+	for e := range entries {
+		got = append(got, e)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("streamHistoryFile(%s): %v", filename, err)
+	}
+	return got, <-skippedc
+}
+
+func TestStreamHistoryFileContinuation(t *testing.T) {
+	filename := writeTempHistory(t, ": 1000000000:0;echo hi \\\nand more\n")
+
+	entries, skipped := drainStream(t, filename)
+	if skipped != 0 {
+		t.Fatalf("skipped = %d, want 0", skipped)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+
+	want := "echo hi \\\nand more"
+	if entries[0].Command != want {
+		t.Errorf("Command = %q, want %q", entries[0].Command, want)
+	}
+}
+
+func TestStreamHistoryFileLiteralBackslash(t *testing.T) {
+	filename := writeTempHistory(t, ": 1000000000:0;echo literal\\\n: 1000000001:0;echo next\n")
+
+	entries, skipped := drainStream(t, filename)
+	if skipped != 0 {
+		t.Fatalf("skipped = %d, want 0", skipped)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+
+	byTime := map[int64]string{}
+	for _, e := range entries {
+		byTime[e.Time] = e.Command
+	}
+	if got := byTime[1000000000]; got != `echo literal\` {
+		t.Errorf("Command at 1000000000 = %q, want %q", got, `echo literal\`)
+	}
+	if got := byTime[1000000001]; got != "echo next" {
+		t.Errorf("Command at 1000000001 = %q, want %q", got, "echo next")
+	}
+}
+
+func TestStreamHistoryFileUnterminatedAtEOF(t *testing.T) {
+	filename := writeTempHistory(t, ": 1000000000:0;echo unterm \\\n")
+
+	entries, skipped := drainStream(t, filename)
+	if skipped != 0 {
+		t.Fatalf("skipped = %d, want 0", skipped)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if want := "echo unterm "; entries[0].Command != want {
+		t.Errorf("Command = %q, want %q", entries[0].Command, want)
+	}
+}
+
+func TestStreamHistoryFileSkipsMalformedEntries(t *testing.T) {
+	filename := writeTempHistory(t, ": 1000000000:0;good one\n: 1000000001:99999999999999999999;bad duration\n: 1000000002:0;good two\n")
+
+	entries, skipped := drainStream(t, filename)
+	if skipped != 1 {
+		t.Fatalf("skipped = %d, want 1", skipped)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"os"
+	"sort"
+)
+
+// sortEntriesToTempFile drains entries, sorts them by timestamp, and writes
+// them gob-encoded to a temp file, returning its path. This keeps a single
+// file's entries out of the final k-way merge's memory until they're
+// actually needed, at the cost of holding one file's worth in RAM here.
+func sortEntriesToTempFile(entries <-chan HistoryEntry) (string, error) {
+	var buffered []HistoryEntry
+	for e := range entries {
+		buffered = append(buffered, e)
+	}
+
+	sort.Slice(buffered, func(i, j int) bool {
+		return buffered[i].Time < buffered[j].Time
+	})
+
+	tmp, err := os.CreateTemp("", "zsh-merge-*.gob")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	enc := gob.NewEncoder(w)
+	for _, e := range buffered {
+		if err := enc.Encode(&e); err != nil {
+			return "", err
+		}
+	}
+
+	return tmp.Name(), w.Flush()
+}